@@ -0,0 +1,358 @@
+package main
+
+import (
+	"slices"
+	"sort"
+
+	"go.lsp.dev/protocol"
+)
+
+// tokenOffset is how far a server's own SemanticTokensLegend indices have to
+// be shifted to land in the merged legend recorded by handleInitialize.
+type tokenOffset struct {
+	tokenType     int
+	tokenModifier int
+}
+
+// semanticLegend is the (tokenTypes, tokenModifiers) pair advertised by a
+// SemanticTokensOptions capability. The go.lsp.dev/protocol package models
+// SemanticTokensProvider as a bare interface{}, so the legend is read out of
+// the decoded JSON map rather than a typed field.
+type semanticLegend struct {
+	tokenTypes     []string
+	tokenModifiers []string
+}
+
+// mergeServerCapabilities combines two servers' capabilities the way an
+// editor-facing multiplexer needs to: trigger-character and command sets are
+// unioned, TextDocumentSync is promoted to whichever side syncs more,
+// provider flags are OR'd rather than letting the second server silently
+// clobber the first, and semantic token legends are concatenated. It returns
+// the offset b's own token/modifier indices need in later
+// textDocument/semanticTokens/full responses so they land in the merged
+// legend.
+func mergeServerCapabilities(a, b protocol.ServerCapabilities) (protocol.ServerCapabilities, tokenOffset) {
+	merged := a
+
+	merged.TextDocumentSync = mergeTextDocumentSync(a.TextDocumentSync, b.TextDocumentSync)
+	merged.CompletionProvider = mergeCompletionOptions(a.CompletionProvider, b.CompletionProvider)
+	merged.ExecuteCommandProvider = mergeExecuteCommandOptions(a.ExecuteCommandProvider, b.ExecuteCommandProvider)
+
+	merged.HoverProvider = orProvider(a.HoverProvider, b.HoverProvider)
+	merged.DefinitionProvider = orProvider(a.DefinitionProvider, b.DefinitionProvider)
+	merged.DeclarationProvider = orProvider(a.DeclarationProvider, b.DeclarationProvider)
+	merged.TypeDefinitionProvider = orProvider(a.TypeDefinitionProvider, b.TypeDefinitionProvider)
+	merged.ImplementationProvider = orProvider(a.ImplementationProvider, b.ImplementationProvider)
+	merged.ReferencesProvider = orProvider(a.ReferencesProvider, b.ReferencesProvider)
+	merged.DocumentHighlightProvider = orProvider(a.DocumentHighlightProvider, b.DocumentHighlightProvider)
+	merged.DocumentSymbolProvider = orProvider(a.DocumentSymbolProvider, b.DocumentSymbolProvider)
+	merged.CodeActionProvider = orProvider(a.CodeActionProvider, b.CodeActionProvider)
+	merged.WorkspaceSymbolProvider = orProvider(a.WorkspaceSymbolProvider, b.WorkspaceSymbolProvider)
+	merged.DocumentFormattingProvider = orProvider(a.DocumentFormattingProvider, b.DocumentFormattingProvider)
+	merged.DocumentRangeFormattingProvider = orProvider(a.DocumentRangeFormattingProvider, b.DocumentRangeFormattingProvider)
+	merged.RenameProvider = orProvider(a.RenameProvider, b.RenameProvider)
+	merged.ColorProvider = orProvider(a.ColorProvider, b.ColorProvider)
+	merged.FoldingRangeProvider = orProvider(a.FoldingRangeProvider, b.FoldingRangeProvider)
+	merged.SelectionRangeProvider = orProvider(a.SelectionRangeProvider, b.SelectionRangeProvider)
+	merged.CallHierarchyProvider = orProvider(a.CallHierarchyProvider, b.CallHierarchyProvider)
+	merged.LinkedEditingRangeProvider = orProvider(a.LinkedEditingRangeProvider, b.LinkedEditingRangeProvider)
+	merged.MonikerProvider = orProvider(a.MonikerProvider, b.MonikerProvider)
+	merged.Experimental = orProvider(a.Experimental, b.Experimental)
+
+	merged.SignatureHelpProvider = orPointer(a.SignatureHelpProvider, b.SignatureHelpProvider)
+	merged.CodeLensProvider = orPointer(a.CodeLensProvider, b.CodeLensProvider)
+	merged.DocumentLinkProvider = orPointer(a.DocumentLinkProvider, b.DocumentLinkProvider)
+	merged.DocumentOnTypeFormattingProvider = orPointer(a.DocumentOnTypeFormattingProvider, b.DocumentOnTypeFormattingProvider)
+	merged.Workspace = orPointer(a.Workspace, b.Workspace)
+
+	aLegend := legendOf(a.SemanticTokensProvider)
+	offset := tokenOffset{tokenType: len(aLegend.tokenTypes), tokenModifier: len(aLegend.tokenModifiers)}
+	merged.SemanticTokensProvider = mergeSemanticTokensProvider(a.SemanticTokensProvider, b.SemanticTokensProvider, aLegend, legendOf(b.SemanticTokensProvider))
+
+	return merged, offset
+}
+
+// orPointer keeps a's capability unless it's nil, falling back to b. It
+// covers the ServerCapabilities fields typed as a concrete options pointer
+// rather than interface{} - there's no bare-bool form to OR and no legend to
+// concatenate, so a nil-coalesce is all that's needed to stop b's capability
+// from being silently dropped when a doesn't support it.
+func orPointer[T any](a, b *T) *T {
+	if a != nil {
+		return a
+	}
+	return b
+}
+
+// orProvider keeps a capability enabled if either side enables it. Two plain
+// bools OR together; a detailed options object counts as "enabled" and is
+// preferred over a bare bool so per-server options aren't lost.
+func orProvider(a, b any) any {
+	ab, aIsBool := a.(bool)
+	bb, bIsBool := b.(bool)
+	if aIsBool && bIsBool {
+		return ab || bb
+	}
+	if a != nil && !aIsBool {
+		return a
+	}
+	if b != nil && !bIsBool {
+		return b
+	}
+	if providerEnabled(a) {
+		return a
+	}
+	return b
+}
+
+func providerEnabled(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	default:
+		return true
+	}
+}
+
+func mergeCompletionOptions(a, b *protocol.CompletionOptions) *protocol.CompletionOptions {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	merged := *a
+	merged.ResolveProvider = a.ResolveProvider || b.ResolveProvider
+	merged.TriggerCharacters = unionStrings(a.TriggerCharacters, b.TriggerCharacters)
+	return &merged
+}
+
+// namespaceExecuteCommands returns a copy of opts with every advertised
+// command prefixed "serverName:" (see namespaceCommand), so identically
+// named commands registered by different servers don't collide once their
+// capabilities are merged.
+func namespaceExecuteCommands(serverName string, opts *protocol.ExecuteCommandOptions) *protocol.ExecuteCommandOptions {
+	if opts == nil {
+		return nil
+	}
+	namespaced := *opts
+	namespaced.Commands = make([]string, len(opts.Commands))
+	for i, command := range opts.Commands {
+		namespaced.Commands[i] = namespaceCommand(serverName, command)
+	}
+	return &namespaced
+}
+
+// namespaceCommand prefixes a bare command name with its owning server's
+// name, so a later workspace/executeCommand (or a CodeAction/CompletionItem
+// Command field carrying it) can be routed back to that exact server.
+func namespaceCommand(serverName, command string) string {
+	return serverName + ":" + command
+}
+
+func mergeExecuteCommandOptions(a, b *protocol.ExecuteCommandOptions) *protocol.ExecuteCommandOptions {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	merged := *a
+	merged.Commands = unionStrings(a.Commands, b.Commands)
+	return &merged
+}
+
+func unionStrings(a, b []string) []string {
+	merged := slices.Clone(a)
+	for _, s := range b {
+		if !slices.Contains(merged, s) {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// mergeTextDocumentSync promotes Change to the more permissive of the two
+// sides' TextDocumentSyncKind and ORs the boolean notification flags.
+// TextDocumentSync is either a bare TextDocumentSyncKind number or a
+// TextDocumentSyncOptions object; syncOptions normalizes both shapes.
+func mergeTextDocumentSync(a, b any) any {
+	aOpts, bOpts := syncOptions(a), syncOptions(b)
+
+	merged := aOpts
+	merged.OpenClose = aOpts.OpenClose || bOpts.OpenClose
+	merged.WillSave = aOpts.WillSave || bOpts.WillSave
+	merged.WillSaveWaitUntil = aOpts.WillSaveWaitUntil || bOpts.WillSaveWaitUntil
+	if bOpts.Change > aOpts.Change {
+		merged.Change = bOpts.Change
+	}
+	if merged.Save == nil {
+		merged.Save = bOpts.Save
+	}
+	return &merged
+}
+
+func syncOptions(v any) protocol.TextDocumentSyncOptions {
+	switch t := v.(type) {
+	case *protocol.TextDocumentSyncOptions:
+		if t == nil {
+			return protocol.TextDocumentSyncOptions{}
+		}
+		return *t
+	case protocol.TextDocumentSyncKind:
+		return protocol.TextDocumentSyncOptions{OpenClose: true, Change: t}
+	case float64:
+		return protocol.TextDocumentSyncOptions{OpenClose: true, Change: protocol.TextDocumentSyncKind(t)}
+	case map[string]any:
+		opts := protocol.TextDocumentSyncOptions{}
+		if open, ok := t["openClose"].(bool); ok {
+			opts.OpenClose = open
+		}
+		if willSave, ok := t["willSave"].(bool); ok {
+			opts.WillSave = willSave
+		}
+		if waitUntil, ok := t["willSaveWaitUntil"].(bool); ok {
+			opts.WillSaveWaitUntil = waitUntil
+		}
+		if change, ok := t["change"].(float64); ok {
+			opts.Change = protocol.TextDocumentSyncKind(change)
+		}
+		return opts
+	default:
+		return protocol.TextDocumentSyncOptions{}
+	}
+}
+
+func legendOf(provider any) semanticLegend {
+	m, ok := provider.(map[string]any)
+	if !ok {
+		return semanticLegend{}
+	}
+	legend, ok := m["legend"].(map[string]any)
+	if !ok {
+		return semanticLegend{}
+	}
+	return semanticLegend{
+		tokenTypes:     stringsOf(legend["tokenTypes"]),
+		tokenModifiers: stringsOf(legend["tokenModifiers"]),
+	}
+}
+
+// stringsOf reads a string slice out of a decoded JSON value ([]any, as
+// encoding/json always produces) or a legend already merged by
+// mergeSemanticTokensProvider in an earlier pass ([]string, stored directly
+// rather than round-tripped through JSON) - mergeServerCapabilities folds
+// servers in one at a time, so a legend it reads may have come from either
+// source.
+func stringsOf(v any) []string {
+	switch items := v.(type) {
+	case []string:
+		return items
+	case []any:
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// mergeSemanticTokensProvider concatenates the legends of two
+// SemanticTokensProvider values and keeps whichever side first declared the
+// full/range request support.
+func mergeSemanticTokensProvider(a, b any, aLegend, bLegend semanticLegend) any {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	merged := map[string]any{}
+	if am, ok := a.(map[string]any); ok {
+		for k, v := range am {
+			merged[k] = v
+		}
+	}
+	if bm, ok := b.(map[string]any); ok {
+		for _, key := range []string{"full", "range"} {
+			if _, ok := merged[key]; !ok {
+				if v, ok := bm[key]; ok {
+					merged[key] = v
+				}
+			}
+		}
+	}
+	merged["legend"] = map[string]any{
+		"tokenTypes":     append(slices.Clone(aLegend.tokenTypes), bLegend.tokenTypes...),
+		"tokenModifiers": append(slices.Clone(aLegend.tokenModifiers), bLegend.tokenModifiers...),
+	}
+	return merged
+}
+
+// semanticToken is a decoded entry of a SemanticTokens.Data stream: absolute
+// line/character rather than the wire format's deltas, so tokens from
+// different servers can be combined and re-sorted.
+type semanticToken struct {
+	line, char, length uint32
+	tokenType          uint32
+	tokenModifiers     uint32
+}
+
+// decodeSemanticTokens expands the line/deltaStartChar-encoded quintuples of
+// a SemanticTokens.Data array into absolute positions, shifting tokenType
+// and tokenModifiers by offset so they index into the merged legend.
+func decodeSemanticTokens(data []uint32, offset tokenOffset) []semanticToken {
+	tokens := make([]semanticToken, 0, len(data)/5)
+
+	var line, char uint32
+	for i := 0; i+5 <= len(data); i += 5 {
+		deltaLine, deltaChar, length, tokenType, modifiers := data[i], data[i+1], data[i+2], data[i+3], data[i+4]
+
+		if deltaLine > 0 {
+			char = 0
+		}
+		line += deltaLine
+		char += deltaChar
+
+		tokens = append(tokens, semanticToken{
+			line:           line,
+			char:           char,
+			length:         length,
+			tokenType:      tokenType + uint32(offset.tokenType),
+			tokenModifiers: modifiers << uint32(offset.tokenModifier),
+		})
+	}
+	return tokens
+}
+
+// encodeSemanticTokens sorts tokens into document order and re-encodes them
+// as line/deltaStartChar-relative quintuples.
+func encodeSemanticTokens(tokens []semanticToken) []uint32 {
+	sort.SliceStable(tokens, func(i, j int) bool {
+		if tokens[i].line != tokens[j].line {
+			return tokens[i].line < tokens[j].line
+		}
+		return tokens[i].char < tokens[j].char
+	})
+
+	data := make([]uint32, 0, len(tokens)*5)
+
+	var line, char uint32
+	for i, t := range tokens {
+		deltaLine := t.line - line
+		deltaChar := t.char
+		if i > 0 && deltaLine == 0 {
+			deltaChar = t.char - char
+		}
+		data = append(data, deltaLine, deltaChar, t.length, t.tokenType, t.tokenModifiers)
+		line, char = t.line, t.char
+	}
+	return data
+}
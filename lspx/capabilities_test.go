@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestDecodeEncodeSemanticTokensRoundTrip(t *testing.T) {
+	data := []uint32{
+		0, 0, 3, 0, 0, // line 0, char 0, "foo", type 0
+		0, 4, 3, 1, 1, // line 0, char 4, "bar", type 1
+		1, 0, 5, 0, 0, // line 1, char 0, "baz!!", type 0
+	}
+
+	tokens := decodeSemanticTokens(data, tokenOffset{})
+	if len(tokens) != 3 {
+		t.Fatalf("len(tokens) = %d, want 3", len(tokens))
+	}
+	want := []semanticToken{
+		{line: 0, char: 0, length: 3, tokenType: 0, tokenModifiers: 0},
+		{line: 0, char: 4, length: 3, tokenType: 1, tokenModifiers: 1},
+		{line: 1, char: 0, length: 5, tokenType: 0, tokenModifiers: 0},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Fatalf("decodeSemanticTokens = %+v, want %+v", tokens, want)
+	}
+
+	if got := encodeSemanticTokens(tokens); !reflect.DeepEqual(got, data) {
+		t.Fatalf("encodeSemanticTokens = %v, want %v", got, data)
+	}
+}
+
+func TestDecodeSemanticTokensShiftsByOffset(t *testing.T) {
+	data := []uint32{0, 0, 3, 2, 1}
+
+	tokens := decodeSemanticTokens(data, tokenOffset{tokenType: 5, tokenModifier: 2})
+	if len(tokens) != 1 {
+		t.Fatalf("len(tokens) = %d, want 1", len(tokens))
+	}
+	if tokens[0].tokenType != 7 {
+		t.Errorf("tokenType = %d, want 7 (2 shifted by 5)", tokens[0].tokenType)
+	}
+	if tokens[0].tokenModifiers != 1<<2 {
+		t.Errorf("tokenModifiers = %d, want %d (bit 0 shifted by 2)", tokens[0].tokenModifiers, 1<<2)
+	}
+}
+
+func semanticTokensProvider(tokenTypes, tokenModifiers []string) map[string]any {
+	return map[string]any{
+		"full": true,
+		"legend": map[string]any{
+			"tokenTypes":     toAnySlice(tokenTypes),
+			"tokenModifiers": toAnySlice(tokenModifiers),
+		},
+	}
+}
+
+func toAnySlice(strs []string) []any {
+	out := make([]any, len(strs))
+	for i, s := range strs {
+		out[i] = s
+	}
+	return out
+}
+
+func TestMergeServerCapabilities(t *testing.T) {
+	a := protocol.ServerCapabilities{
+		HoverProvider:          true,
+		DefinitionProvider:     false,
+		SemanticTokensProvider: semanticTokensProvider([]string{"function", "variable"}, []string{"readonly"}),
+	}
+	b := protocol.ServerCapabilities{
+		HoverProvider:          false,
+		DefinitionProvider:     true,
+		CodeLensProvider:       &protocol.CodeLensOptions{ResolveProvider: true},
+		SemanticTokensProvider: semanticTokensProvider([]string{"keyword"}, []string{"deprecated"}),
+	}
+
+	merged, offset := mergeServerCapabilities(a, b)
+
+	if merged.HoverProvider != true {
+		t.Errorf("HoverProvider = %v, want true (enabled by a)", merged.HoverProvider)
+	}
+	if merged.DefinitionProvider != true {
+		t.Errorf("DefinitionProvider = %v, want true (enabled by b)", merged.DefinitionProvider)
+	}
+	if merged.CodeLensProvider != b.CodeLensProvider {
+		t.Errorf("CodeLensProvider = %v, want b's (a left it nil)", merged.CodeLensProvider)
+	}
+
+	wantOffset := tokenOffset{tokenType: 2, tokenModifier: 1}
+	if offset != wantOffset {
+		t.Errorf("offset = %+v, want %+v (length of a's legend)", offset, wantOffset)
+	}
+
+	legend := legendOf(merged.SemanticTokensProvider)
+	wantTypes := []string{"function", "variable", "keyword"}
+	if !reflect.DeepEqual(legend.tokenTypes, wantTypes) {
+		t.Errorf("merged tokenTypes = %v, want %v", legend.tokenTypes, wantTypes)
+	}
+	wantModifiers := []string{"readonly", "deprecated"}
+	if !reflect.DeepEqual(legend.tokenModifiers, wantModifiers) {
+		t.Errorf("merged tokenModifiers = %v, want %v", legend.tokenModifiers, wantModifiers)
+	}
+}
+
+// TestMergeServerCapabilitiesChained covers three-or-more servers, where the
+// second mergeServerCapabilities call reads a legend that the first call
+// already merged and stored as []string, rather than the []any a
+// JSON-decoded legend would be.
+func TestMergeServerCapabilitiesChained(t *testing.T) {
+	a := protocol.ServerCapabilities{SemanticTokensProvider: semanticTokensProvider([]string{"function"}, nil)}
+	b := protocol.ServerCapabilities{SemanticTokensProvider: semanticTokensProvider([]string{"keyword"}, nil)}
+	c := protocol.ServerCapabilities{SemanticTokensProvider: semanticTokensProvider([]string{"variable"}, nil)}
+
+	merged, _ := mergeServerCapabilities(a, b)
+	merged, offset := mergeServerCapabilities(merged, c)
+
+	wantOffset := tokenOffset{tokenType: 2}
+	if offset != wantOffset {
+		t.Fatalf("offset = %+v, want %+v (a+b's combined legend length)", offset, wantOffset)
+	}
+
+	legend := legendOf(merged.SemanticTokensProvider)
+	wantTypes := []string{"function", "keyword", "variable"}
+	if !reflect.DeepEqual(legend.tokenTypes, wantTypes) {
+		t.Fatalf("merged tokenTypes = %v, want %v", legend.tokenTypes, wantTypes)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ServerConfig describes one backing language server: how to start it and
+// which documents it should be routed.
+type ServerConfig struct {
+	Command string            `json:"command" yaml:"command"`
+	Args    []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	// RootPatterns are file or glob names (e.g. "go.mod", ".git") looked
+	// up from the document's directory upward; if set, the server only
+	// matches documents inside a tree that contains one of them.
+	RootPatterns []string `json:"root_patterns,omitempty" yaml:"root_patterns,omitempty"`
+
+	// Filetypes are LSP languageIds (e.g. "go", "python") the server
+	// handles. Glob is an additional filename glob, matched against the
+	// document's base name. A document matches if either is satisfied.
+	Filetypes []string `json:"filetypes,omitempty" yaml:"filetypes,omitempty"`
+	Glob      string   `json:"glob,omitempty" yaml:"glob,omitempty"`
+}
+
+// Matches reports whether the server should handle a document with the
+// given filename and languageId.
+func (c ServerConfig) Matches(filename, languageId string) bool {
+	matched := slices.Contains(c.Filetypes, languageId)
+	if !matched && c.Glob != "" {
+		if ok, _ := filepath.Match(c.Glob, filepath.Base(filename)); ok {
+			matched = true
+		}
+	}
+	if !matched {
+		return false
+	}
+	if len(c.RootPatterns) > 0 && !hasRootMarker(filepath.Dir(filename), c.RootPatterns) {
+		return false
+	}
+	return true
+}
+
+// MatchesRoot reports whether the server should be started eagerly for a
+// workspace rooted at root. Unlike Matches, it's evaluated before any
+// document is known - at handleInitialize time - so only RootPatterns can
+// be checked; Filetypes/Glob need a specific file. A server with no
+// RootPatterns has no root-based signal to eagerly start on and is left to
+// ensureServers's lazy, didOpen-triggered path instead, the same as it
+// would be for any document once one is opened.
+func (c ServerConfig) MatchesRoot(root string) bool {
+	if len(c.RootPatterns) == 0 {
+		return false
+	}
+	return hasRootMarker(root, c.RootPatterns)
+}
+
+// hasRootMarker walks up from dir looking for a file matching one of
+// patterns, stopping at the filesystem root.
+func hasRootMarker(dir string, patterns []string) bool {
+	for {
+		for _, pattern := range patterns {
+			if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+				return true
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
+
+// Config is the lspx multiplexer config, loaded from a YAML or JSON file via
+// the --config flag.
+type Config struct {
+	Servers map[string]ServerConfig `json:"servers" yaml:"servers"`
+
+	// DedupeDiagnostics collapses diagnostics with an identical
+	// (range, code, message) reported by more than one server.
+	DedupeDiagnostics bool `json:"dedupe_diagnostics,omitempty" yaml:"dedupe_diagnostics,omitempty"`
+
+	// RequestDeadlines overrides defaultRequestDeadlines, in milliseconds,
+	// keyed by LSP method name (e.g. "textDocument/completion"). A server
+	// that doesn't answer a fanned-out request within its deadline is
+	// dropped rather than holding up the others; see ProxyServer.deadlines.
+	RequestDeadlines map[string]int `json:"request_deadlines,omitempty" yaml:"request_deadlines,omitempty"`
+}
+
+// RequestDeadlineDurations converts RequestDeadlines to the map[string]time.Duration
+// NewProxyServer expects.
+func (c Config) RequestDeadlineDurations() map[string]time.Duration {
+	if len(c.RequestDeadlines) == 0 {
+		return nil
+	}
+	durations := make(map[string]time.Duration, len(c.RequestDeadlines))
+	for method, ms := range c.RequestDeadlines {
+		durations[method] = time.Duration(ms) * time.Millisecond
+	}
+	return durations
+}
+
+// LoadConfig reads and parses the config at path, choosing YAML or JSON
+// based on its extension.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".json":
+		err = json.Unmarshal(data, cfg)
+	default:
+		return nil, fmt.Errorf("lspx: unsupported config extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lspx: parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServerConfigMatches(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		cfg        ServerConfig
+		filename   string
+		languageId string
+		want       bool
+	}{
+		{
+			name:       "matches by filetype",
+			cfg:        ServerConfig{Filetypes: []string{"go"}},
+			filename:   filepath.Join(sub, "main.go"),
+			languageId: "go",
+			want:       true,
+		},
+		{
+			name:       "filetype mismatch",
+			cfg:        ServerConfig{Filetypes: []string{"python"}},
+			filename:   filepath.Join(sub, "main.go"),
+			languageId: "go",
+			want:       false,
+		},
+		{
+			name:       "matches by glob when filetype doesn't",
+			cfg:        ServerConfig{Filetypes: []string{"python"}, Glob: "*.go"},
+			filename:   filepath.Join(sub, "main.go"),
+			languageId: "go",
+			want:       true,
+		},
+		{
+			name:       "root pattern found up the tree",
+			cfg:        ServerConfig{Filetypes: []string{"go"}, RootPatterns: []string{"go.mod"}},
+			filename:   filepath.Join(sub, "main.go"),
+			languageId: "go",
+			want:       true,
+		},
+		{
+			name:       "root pattern missing",
+			cfg:        ServerConfig{Filetypes: []string{"go"}, RootPatterns: []string{"Cargo.toml"}},
+			filename:   filepath.Join(sub, "main.go"),
+			languageId: "go",
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.Matches(tt.filename, tt.languageId); got != tt.want {
+				t.Errorf("Matches(%q, %q) = %v, want %v", tt.filename, tt.languageId, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerConfigMatchesRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty := t.TempDir()
+
+	tests := []struct {
+		name string
+		cfg  ServerConfig
+		root string
+		want bool
+	}{
+		{
+			name: "no root patterns never eager-starts",
+			cfg:  ServerConfig{Glob: "*.css"},
+			root: empty,
+			want: false,
+		},
+		{
+			name: "root pattern present at root",
+			cfg:  ServerConfig{RootPatterns: []string{"go.mod"}},
+			root: root,
+			want: true,
+		},
+		{
+			name: "root pattern absent",
+			cfg:  ServerConfig{RootPatterns: []string{"go.mod"}},
+			root: empty,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.MatchesRoot(tt.root); got != tt.want {
+				t.Errorf("MatchesRoot(%q) = %v, want %v", tt.root, got, tt.want)
+			}
+		})
+	}
+}
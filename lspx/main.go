@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+func main() {
+	app := &cli.App{
+		Name:  "lspx",
+		Usage: "multiplex several language servers behind a single LSP connection over stdio",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Aliases:  []string{"c"},
+				Usage:    "path to a YAML or JSON lspx config file",
+				Required: true,
+			},
+		},
+		Action: run,
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(c *cli.Context) error {
+	cfg, err := LoadConfig(c.String("config"))
+	if err != nil {
+		return err
+	}
+
+	proxy, err := NewProxyServer(context.Background(), cfg.Servers, cfg.DedupeDiagnostics, cfg.RequestDeadlineDurations())
+	if err != nil {
+		return err
+	}
+	return proxy.Wait()
+}
@@ -9,47 +9,370 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sourcegraph/jsonrpc2"
 	"go.lsp.dev/protocol"
 )
 
+// defaultRequestTimeout is the outstanding-request timeout used when a
+// ProcessServer isn't given one explicitly.
+const defaultRequestTimeout = 10 * time.Second
+
+// slowWindowSize is how many of a server's most recent fan-out deadlines
+// (see CallWithDeadline) are remembered to decide whether it's degrading.
+// minSlowSamples is the fewest of those that must have been recorded before
+// Slow will report true at all, so one unlucky call right after startup
+// doesn't immediately flag a server as degraded.
+const (
+	slowWindowSize = 20
+	minSlowSamples = 5
+)
+
+// fanoutCallID assigns the IDs CallWithDeadline picks for its calls, so they
+// stay out of the issuing Conn's own auto-assigned sequence and can later be
+// referenced in a $/cancelRequest.
+var fanoutCallID atomic.Uint64
+
+// ServerStatus is the per-server health snapshot returned by the
+// lspx.status custom method.
+type ServerStatus struct {
+	Name      string    `json:"name"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+
+	// Slow reports whether this server has timed out on more than half of
+	// its last slowWindowSize fan-out deadlines.
+	Slow bool `json:"slow"`
+}
+
 type ProcessServer struct {
-	cmd    *exec.Cmd
-	name   string
-	stdin  io.ReadCloser
-	stdout io.WriteCloser
+	newCmd  func() *exec.Cmd
+	timeout time.Duration
+
+	mu         sync.Mutex
+	cmd        *exec.Cmd
+	name       string
+	stdin      io.ReadCloser
+	stdout     io.WriteCloser
+	startedAt  time.Time
+	restarts   int
+	lastErr    error
+	restarting bool
+
+	initializeParams  *json.RawMessage
+	initializedParams *json.RawMessage
+	docs              map[protocol.DocumentURI]*json.RawMessage
+
+	slowMu     sync.Mutex
+	slowWindow []bool
 
 	conn      *jsonrpc2.Conn
 	proxyConn *jsonrpc2.Conn
+	proxy     *ProxyServer
 }
 
 func (s *ProcessServer) Name() string {
 	return s.name
 }
 
+// hasDoc reports whether uri was opened on this server via
+// textDocument/didOpen and hasn't been closed since.
+func (s *ProcessServer) hasDoc(uri protocol.DocumentURI) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.docs[uri]
+	return ok
+}
+
+// Status returns a snapshot of the server's health for the lspx.status
+// custom method.
+func (s *ProcessServer) Status() ServerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ServerStatus{
+		Name:      s.name,
+		PID:       s.cmd.Process.Pid,
+		StartedAt: s.startedAt,
+		Restarts:  s.restarts,
+		Slow:      s.Slow(),
+	}
+	if s.lastErr != nil {
+		status.LastError = s.lastErr.Error()
+	}
+	return status
+}
+
+// recordSlow appends the outcome of a fan-out deadline to the rolling
+// window, dropping the oldest entry once it's full.
+func (s *ProcessServer) recordSlow(timedOut bool) {
+	s.slowMu.Lock()
+	defer s.slowMu.Unlock()
+
+	s.slowWindow = append(s.slowWindow, timedOut)
+	if len(s.slowWindow) > slowWindowSize {
+		s.slowWindow = s.slowWindow[len(s.slowWindow)-slowWindowSize:]
+	}
+}
+
+// Slow reports whether this server timed out on more than half of its last
+// slowWindowSize fan-out deadlines, once at least minSlowSamples have been
+// recorded.
+func (s *ProcessServer) Slow() bool {
+	s.slowMu.Lock()
+	defer s.slowMu.Unlock()
+
+	if len(s.slowWindow) < minSlowSamples {
+		return false
+	}
+
+	var timedOut int
+	for _, to := range s.slowWindow {
+		if to {
+			timedOut++
+		}
+	}
+	return timedOut*2 > len(s.slowWindow)
+}
+
 func (s *ProcessServer) Read(p []byte) (int, error) {
-	return s.stdin.Read(p)
+	s.mu.Lock()
+	stdin := s.stdin
+	s.mu.Unlock()
+	return stdin.Read(p)
 }
 
 func (s *ProcessServer) Write(p []byte) (int, error) {
-	return s.stdout.Write(p)
+	s.mu.Lock()
+	stdout := s.stdout
+	s.mu.Unlock()
+	return stdout.Write(p)
 }
 
 func (s *ProcessServer) Close() error {
-	return errors.Join(s.stdin.Close(), s.stdout.Close(), s.cmd.Process.Kill())
+	s.mu.Lock()
+	stdin, stdout, cmd := s.stdin, s.stdout, s.cmd
+	s.mu.Unlock()
+	return errors.Join(stdin.Close(), stdout.Close(), cmd.Process.Kill())
 }
 
 func (s *ProcessServer) Call(ctx context.Context, method string, params *json.RawMessage, result any) error {
-	return s.conn.Call(ctx, method, params, result)
+	if method == protocol.MethodInitialize {
+		s.mu.Lock()
+		s.initializeParams = params
+		s.mu.Unlock()
+	}
+
+	callCtx := ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	err := conn.Call(callCtx, method, params, result)
+
+	s.mu.Lock()
+	s.lastErr = err
+	s.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil && callCtx.Err() == context.DeadlineExceeded {
+		go s.restart(ctx, fmt.Errorf("%s: %q timed out after %s", s.name, method, s.timeout))
+	}
+	return err
+}
+
+// CallWithDeadline is like Call, but bounded by deadline independently of
+// the server's own outstanding-request timeout: a single slow answer here
+// doesn't trigger a restart. If deadline fires first, a $/cancelRequest is
+// sent for this call so the backend can give up on it, the partial result
+// is discarded, and the miss is recorded via recordSlow. Pass deadline <= 0
+// to skip all of this and fall back to Call.
+func (s *ProcessServer) CallWithDeadline(ctx context.Context, method string, params *json.RawMessage, result any, deadline time.Duration) (timedOut bool, err error) {
+	if deadline <= 0 {
+		return false, s.Call(ctx, method, params, result)
+	}
+
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	id := jsonrpc2.ID{Str: fmt.Sprintf("lspx-fanout-%d", fanoutCallID.Add(1)), IsString: true}
+	waiter, err := conn.DispatchCall(ctx, method, params, jsonrpc2.PickID(id))
+	if err != nil {
+		return false, err
+	}
+
+	deadlineCtx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	err = waiter.Wait(deadlineCtx, result)
+	if err != nil && ctx.Err() == nil && deadlineCtx.Err() == context.DeadlineExceeded {
+		if cancelErr := conn.Notify(ctx, protocol.MethodCancelRequest, protocol.CancelParams{ID: id.Str}); cancelErr != nil {
+			s.mu.Lock()
+			s.lastErr = fmt.Errorf("%s: cancel %q: %w", s.name, method, cancelErr)
+			s.mu.Unlock()
+		}
+		s.recordSlow(true)
+		return true, err
+	}
+	s.recordSlow(false)
+	return false, err
 }
 
 func (s *ProcessServer) Notify(ctx context.Context, method string, params *json.RawMessage) error {
-	return s.conn.Notify(ctx, method, params)
+	switch method {
+	case protocol.MethodInitialized:
+		s.mu.Lock()
+		s.initializedParams = params
+		s.mu.Unlock()
+	case protocol.MethodTextDocumentDidOpen:
+		var doc protocol.DidOpenTextDocumentParams
+		if err := json.Unmarshal(*params, &doc); err == nil {
+			s.mu.Lock()
+			s.docs[doc.TextDocument.URI] = params
+			s.mu.Unlock()
+		}
+	case protocol.MethodTextDocumentDidClose:
+		var doc protocol.DidCloseTextDocumentParams
+		if err := json.Unmarshal(*params, &doc); err == nil {
+			s.mu.Lock()
+			delete(s.docs, doc.TextDocument.URI)
+			s.mu.Unlock()
+		}
+	}
+
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	return conn.Notify(ctx, method, params)
+}
+
+// watch blocks until the backing process exits, then restarts it unless ctx
+// has already been cancelled (i.e. the proxy itself is shutting down).
+func (s *ProcessServer) watch(ctx context.Context) {
+	s.mu.Lock()
+	cmd := s.cmd
+	s.mu.Unlock()
+
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	if err == nil {
+		err = errors.New("process exited")
+	}
+	s.restart(ctx, fmt.Errorf("%s: %w", s.name, err))
+}
+
+// restart re-spawns the backing process after a crash or a request timeout,
+// then replays the cached initialize/initialized handshake and any open
+// documents so the new instance ends up in the same state as the one it
+// replaces. Subsequent client/registerCapability calls the new process
+// issues during that handshake flow through Handle as usual.
+func (s *ProcessServer) restart(ctx context.Context, cause error) {
+	s.mu.Lock()
+	if s.restarting {
+		s.mu.Unlock()
+		return
+	}
+	s.restarting = true
+	s.lastErr = cause
+	stdin, stdout, oldConn, oldCmd := s.stdin, s.stdout, s.conn, s.cmd
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.restarting = false
+		s.mu.Unlock()
+	}()
+
+	stdin.Close()
+	stdout.Close()
+	oldConn.Close()
+	oldCmd.Process.Kill()
+
+	cmd := s.newCmd()
+	newStdin, err := cmd.StdinPipe()
+	if err != nil {
+		s.mu.Lock()
+		s.lastErr = fmt.Errorf("restart %s: %w", s.name, err)
+		s.mu.Unlock()
+		return
+	}
+	newStdout, err := cmd.StdoutPipe()
+	if err != nil {
+		s.mu.Lock()
+		s.lastErr = fmt.Errorf("restart %s: %w", s.name, err)
+		s.mu.Unlock()
+		return
+	}
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		s.mu.Lock()
+		s.lastErr = fmt.Errorf("restart %s: %w", s.name, err)
+		s.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	s.cmd = cmd
+	s.stdin = newStdout
+	s.stdout = newStdin
+	s.startedAt = time.Now()
+	s.restarts++
+	s.conn = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(s, jsonrpc2.VSCodeObjectCodec{}), s)
+	conn := s.conn
+	initializeParams := s.initializeParams
+	initializedParams := s.initializedParams
+	docs := make([]*json.RawMessage, 0, len(s.docs))
+	for _, params := range s.docs {
+		docs = append(docs, params)
+	}
+	s.mu.Unlock()
+
+	go s.watch(ctx)
+
+	if initializeParams != nil {
+		var result json.RawMessage
+		if err := conn.Call(ctx, protocol.MethodInitialize, initializeParams, &result); err != nil {
+			s.mu.Lock()
+			s.lastErr = fmt.Errorf("replay initialize to %s: %w", s.name, err)
+			s.mu.Unlock()
+			return
+		}
+	}
+	if initializedParams != nil {
+		conn.Notify(ctx, protocol.MethodInitialized, initializedParams)
+	}
+	for _, params := range docs {
+		conn.Notify(ctx, protocol.MethodTextDocumentDidOpen, params)
+	}
 }
 
 func (s *ProcessServer) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
 	if req.Notif {
+		if req.Method == protocol.MethodTextDocumentPublishDiagnostics {
+			var params protocol.PublishDiagnosticsParams
+			if err := json.Unmarshal(*req.Params, &params); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+			if err := s.proxy.handleTextDocumentPublishDiagnostics(ctx, s.name, params); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			return
+		}
 		s.proxyConn.Notify(ctx, req.Method, req.Params)
 		return
 	}
@@ -104,7 +427,16 @@ func (s *ProcessServer) handle(ctx context.Context, req *jsonrpc2.Request) (any,
 	return result, nil
 }
 
-func NewProcessServer(ctx context.Context, cmd *exec.Cmd) (*ProcessServer, error) {
+// NewProcessServer starts the language server produced by newCmd and
+// supervises it for the lifetime of ctx: if the process crashes or an
+// outstanding request exceeds timeout, it is transparently re-spawned via
+// newCmd. Pass timeout <= 0 to fall back to defaultRequestTimeout.
+func NewProcessServer(ctx context.Context, newCmd func() *exec.Cmd, timeout time.Duration) (*ProcessServer, error) {
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+
+	cmd := newCmd()
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return nil, err
@@ -120,12 +452,17 @@ func NewProcessServer(ctx context.Context, cmd *exec.Cmd) (*ProcessServer, error
 	}
 
 	proc := &ProcessServer{
-		cmd:    cmd,
-		name:   filepath.Base(cmd.Path),
-		stdin:  stdout,
-		stdout: stdin,
+		newCmd:    newCmd,
+		timeout:   timeout,
+		cmd:       cmd,
+		name:      filepath.Base(cmd.Path),
+		stdin:     stdout,
+		stdout:    stdin,
+		startedAt: time.Now(),
+		docs:      make(map[protocol.DocumentURI]*json.RawMessage),
 	}
 
 	proc.conn = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(proc, jsonrpc2.VSCodeObjectCodec{}), proc)
+	go proc.watch(ctx)
 	return proc, nil
 }
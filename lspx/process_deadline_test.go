@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// fanoutHandler answers "fast" immediately and lets "slow" hang until the
+// caller's $/cancelRequest arrives, recording the cancelled call's ID.
+type fanoutHandler struct {
+	cancelled chan string
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	switch req.Method {
+	case "fast":
+		conn.Reply(ctx, req.ID, "ok")
+	case protocol.MethodCancelRequest:
+		var params protocol.CancelParams
+		if err := json.Unmarshal(*req.Params, &params); err == nil {
+			h.cancelled <- params.ID.(string)
+		}
+	}
+	// "slow" is left unanswered; the test only cares that it gets cancelled.
+}
+
+func newFanoutPipe(t *testing.T, handler jsonrpc2.Handler) *jsonrpc2.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+
+	ctx := context.Background()
+	jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(server, jsonrpc2.VSCodeObjectCodec{}), handler)
+	return jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(client, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(
+		func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			return nil, nil
+		}))
+}
+
+func TestCallWithDeadlineTimesOutAndCancels(t *testing.T) {
+	handler := &fanoutHandler{cancelled: make(chan string, 1)}
+	conn := newFanoutPipe(t, handler)
+	s := &ProcessServer{name: "slow-server", conn: conn}
+
+	var result json.RawMessage
+	timedOut, err := s.CallWithDeadline(context.Background(), "slow", nil, &result, 20*time.Millisecond)
+
+	if !timedOut {
+		t.Fatal("timedOut = false, want true")
+	}
+	if err == nil {
+		t.Fatal("err = nil, want a deadline error")
+	}
+
+	select {
+	case id := <-handler.cancelled:
+		if id == "" {
+			t.Error("cancelled with an empty call ID")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no $/cancelRequest observed after the deadline fired")
+	}
+
+	if got := len(s.slowWindow); got != 1 || !s.slowWindow[0] {
+		t.Errorf("slowWindow = %v, want a single recorded timeout", s.slowWindow)
+	}
+}
+
+func TestCallWithDeadlineFastPathDoesNotCancel(t *testing.T) {
+	handler := &fanoutHandler{cancelled: make(chan string, 1)}
+	conn := newFanoutPipe(t, handler)
+	s := &ProcessServer{name: "fast-server", conn: conn}
+
+	var result string
+	timedOut, err := s.CallWithDeadline(context.Background(), "fast", nil, &result, time.Second)
+
+	if timedOut {
+		t.Fatal("timedOut = true, want false")
+	}
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	if result != "ok" {
+		t.Errorf("result = %q, want %q", result, "ok")
+	}
+
+	select {
+	case id := <-handler.cancelled:
+		t.Fatalf("unexpected $/cancelRequest for %q on the fast path", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
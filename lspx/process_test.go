@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestProcessServerSlow(t *testing.T) {
+	s := &ProcessServer{}
+
+	if s.Slow() {
+		t.Fatal("Slow() = true before any samples were recorded")
+	}
+
+	for i := 0; i < minSlowSamples-1; i++ {
+		s.recordSlow(true)
+	}
+	if s.Slow() {
+		t.Fatal("Slow() = true with fewer than minSlowSamples recorded")
+	}
+
+	s.recordSlow(true)
+	if !s.Slow() {
+		t.Fatal("Slow() = false with minSlowSamples timeouts recorded")
+	}
+
+	for i := 0; i < slowWindowSize; i++ {
+		s.recordSlow(false)
+	}
+	if s.Slow() {
+		t.Fatal("Slow() = true after the timed-out samples rolled out of the window")
+	}
+}
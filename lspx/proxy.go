@@ -5,13 +5,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sourcegraph/jsonrpc2"
 	"go.lsp.dev/protocol"
 	"golang.org/x/sync/errgroup"
 )
 
+// defaultRequestDeadlines bounds how long handleProcs waits on a single
+// backend before dropping it and moving on, keyed by LSP method. Methods
+// with no entry here have no deadline: handleProcs waits for every backend,
+// the same as before per-request deadlines existed.
+var defaultRequestDeadlines = map[string]time.Duration{
+	protocol.MethodTextDocumentCompletion: 2 * time.Second,
+}
+
 type stdrwc struct{}
 
 func (stdrwc) Read(p []byte) (int, error) {
@@ -27,14 +40,286 @@ func (c stdrwc) Close() error {
 }
 
 type ProxyServer struct {
-	conn  *jsonrpc2.Conn
-	procs []*ProcessServer
+	conn *jsonrpc2.Conn
+
+	// configs declares every server the multiplexer knows about, keyed
+	// by name; procs holds only the ones that have actually been
+	// started, either from handleInitialize (RootPatterns matching the
+	// workspace root) or lazily on first matching textDocument/didOpen.
+	configs map[string]ServerConfig
+
+	mu                sync.Mutex
+	procs             map[string]*ProcessServer
+	clientInitialize  *json.RawMessage
+	clientInitialized *json.RawMessage
+
+	// legendOffsets records, per server name, how far that server's own
+	// SemanticTokensLegend indices were shifted when its capabilities were
+	// folded into the merged legend. Populated incrementally by
+	// recordLegendOffset - once per server, however and whenever it was
+	// started - and read by handleTextDocumentSemanticTokensFull.
+	legendOffsets map[string]tokenOffset
+
+	// legendLen is the running size of the merged semantic-tokens legend:
+	// the total tokenTypes/tokenModifiers folded in by every server
+	// recorded in legendOffsets so far. Advanced by recordLegendOffset.
+	legendLen tokenOffset
+
+	// dedupeDiagnostics collapses diagnostics with an identical
+	// (range, code, message) across servers before they're forwarded.
+	dedupeDiagnostics bool
+
+	// deadlines overrides defaultRequestDeadlines per method; read by
+	// deadlineFor. Set once in NewProxyServer.
+	deadlines map[string]time.Duration
+
+	// commands maps each serverName-prefixed command advertised at
+	// handleInitialize time (see namespaceExecuteCommands) back to the
+	// server that registered it, so handleWorkspaceExecuteCommand can route
+	// to exactly that ProcessServer instead of broadcasting.
+	commands map[string]string
+
+	diagMu      sync.Mutex
+	diagnostics map[protocol.DocumentURI]map[string][]protocol.Diagnostic
+}
+
+// running returns a snapshot of the currently started servers.
+func (s *ProxyServer) running() []*ProcessServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	procs := make([]*ProcessServer, 0, len(s.procs))
+	for _, proc := range s.procs {
+		procs = append(procs, proc)
+	}
+	return procs
+}
+
+// runningFor returns the started servers that have uri open, i.e. the ones
+// that received a matching textDocument/didOpen.
+func (s *ProxyServer) runningFor(uri protocol.DocumentURI) []*ProcessServer {
+	var matched []*ProcessServer
+	for _, proc := range s.running() {
+		if proc.hasDoc(uri) {
+			matched = append(matched, proc)
+		}
+	}
+	return matched
+}
+
+// ensureServersMatching synchronously starts every configured server for
+// which match returns true and hasn't been started yet, replays the
+// client's cached initialize/initialized handshake into each of them (see
+// bootstrap), and returns every matching server, started just now or
+// already running. A newly started server is only added to s.procs once
+// its handshake has replayed successfully, so a bootstrap failure can't
+// leave an un-initialized process registered for later requests to be
+// routed to. It also returns, keyed by name, the InitializeResult of every
+// server it bootstrapped just now (not ones that were already running), so
+// a caller that needs their capabilities - handleInitialize - doesn't have
+// to ask those servers to initialize a second time.
+func (s *ProxyServer) ensureServersMatching(ctx context.Context, match func(ServerConfig) bool) ([]*ProcessServer, map[string]protocol.InitializeResult, error) {
+	var matching, pending []*ProcessServer
+
+	s.mu.Lock()
+	for name, cfg := range s.configs {
+		if !match(cfg) {
+			continue
+		}
+
+		if proc, ok := s.procs[name]; ok {
+			matching = append(matching, proc)
+			continue
+		}
+
+		proc, err := s.startServer(ctx, name, cfg)
+		if err != nil {
+			s.mu.Unlock()
+			for _, p := range pending {
+				p.Close()
+			}
+			return nil, nil, fmt.Errorf("start %s: %w", name, err)
+		}
+		pending = append(pending, proc)
+	}
+	s.mu.Unlock()
+
+	bootstrapped := make(map[string]protocol.InitializeResult, len(pending))
+	for _, proc := range pending {
+		result, err := s.bootstrap(ctx, proc)
+		if err != nil {
+			proc.Close()
+			return nil, nil, fmt.Errorf("bootstrap %s: %w", proc.name, err)
+		}
+		bootstrapped[proc.name] = result
+
+		s.mu.Lock()
+		s.procs[proc.name] = proc
+		s.mu.Unlock()
+		matching = append(matching, proc)
+	}
+	return matching, bootstrapped, nil
+}
+
+// ensureServers lazily starts every configured server whose filters match
+// filename/languageId and haven't been started yet. Most servers are
+// already running by the time this is called, started eagerly from
+// handleInitialize by ensureServersForRoot; this catches ones whose config
+// has no RootPatterns to resolve a workspace root against, and ones whose
+// RootPatterns are only found from the opened document's directory upward
+// rather than from the workspace root.
+func (s *ProxyServer) ensureServers(ctx context.Context, uri protocol.DocumentURI, languageId string) ([]*ProcessServer, error) {
+	filename := uri.Filename()
+	procs, _, err := s.ensureServersMatching(ctx, func(cfg ServerConfig) bool {
+		return cfg.Matches(filename, languageId)
+	})
+	return procs, err
+}
+
+// ensureServersForRoot synchronously starts every configured server whose
+// RootPatterns match the workspace root the client initialized with, so
+// handleInitialize can reply with their merged capabilities instead of an
+// empty InitializeResult. Called before the client ever has a chance to
+// send textDocument/didOpen, so - unlike ensureServers - it can't match on
+// Filetypes/Glob; servers that rely on those alone keep starting lazily
+// from ensureServers once a matching document is opened.
+func (s *ProxyServer) ensureServersForRoot(ctx context.Context, root string) ([]*ProcessServer, map[string]protocol.InitializeResult, error) {
+	return s.ensureServersMatching(ctx, func(cfg ServerConfig) bool {
+		return cfg.MatchesRoot(root)
+	})
+}
+
+// workspaceRoot extracts the workspace root path from a client's
+// initialize params, preferring WorkspaceFolders (the current LSP way) and
+// falling back to the deprecated RootURI/RootPath fields older clients
+// still send. Returns "" if none of them are set.
+func workspaceRoot(params *json.RawMessage) string {
+	if params == nil {
+		return ""
+	}
+
+	var v struct {
+		RootPath         string                     `json:"rootPath"`
+		RootURI          protocol.DocumentURI       `json:"rootUri"`
+		WorkspaceFolders []protocol.WorkspaceFolder `json:"workspaceFolders"`
+	}
+	if err := json.Unmarshal(*params, &v); err != nil {
+		return ""
+	}
+
+	if len(v.WorkspaceFolders) > 0 {
+		return protocol.DocumentURI(v.WorkspaceFolders[0].URI).Filename()
+	}
+	if v.RootURI != "" {
+		return v.RootURI.Filename()
+	}
+	return v.RootPath
 }
 
-func handleProcs[T any](ctx context.Context, req *jsonrpc2.Request, procs []*ProcessServer) ([]T, error) {
+// startServer spawns a not-yet-running configured server.
+func (s *ProxyServer) startServer(ctx context.Context, name string, cfg ServerConfig) (*ProcessServer, error) {
+	newCmd := func() *exec.Cmd {
+		cmd := exec.Command(cfg.Command, cfg.Args...)
+		if len(cfg.Env) > 0 {
+			cmd.Env = os.Environ()
+			for k, v := range cfg.Env {
+				cmd.Env = append(cmd.Env, k+"="+v)
+			}
+		}
+		return cmd
+	}
+
+	proc, err := NewProcessServer(ctx, newCmd, 0)
+	if err != nil {
+		return nil, err
+	}
+	proc.name = name
+	proc.proxyConn = s.conn
+	proc.proxy = s
+	return proc, nil
+}
+
+// bootstrap replays the client's initialize/initialized handshake into a
+// freshly-started server, the same way ProcessServer.restart replays it
+// after a crash, and returns the server's own InitializeResult so a caller
+// that needs it (handleInitialize, for servers started eagerly by
+// ensureServersForRoot) doesn't have to ask it to initialize again. Servers
+// started later by ensureServers go through here too, well after
+// handleInitialize has already replied to the client, so this is also
+// where every server - regardless of when it starts - gets its commands
+// namespaced and recorded (registerCommands) and its semantic-tokens legend
+// folded into the merged one (recordLegendOffset); otherwise
+// workspace/executeCommand could never route to it and its semantic tokens
+// would collide with another server's.
+func (s *ProxyServer) bootstrap(ctx context.Context, proc *ProcessServer) (protocol.InitializeResult, error) {
+	s.mu.Lock()
+	initialize, initialized := s.clientInitialize, s.clientInitialized
+	s.mu.Unlock()
+
+	if initialize == nil {
+		return protocol.InitializeResult{}, nil
+	}
+	var result protocol.InitializeResult
+	if err := proc.Call(ctx, protocol.MethodInitialize, initialize, &result); err != nil {
+		return protocol.InitializeResult{}, err
+	}
+
+	result.Capabilities.ExecuteCommandProvider = s.registerCommands(proc.name, result.Capabilities.ExecuteCommandProvider)
+	s.recordLegendOffset(proc.name, result.Capabilities)
+
+	if initialized != nil {
+		if err := proc.Notify(ctx, protocol.MethodInitialized, initialized); err != nil {
+			return protocol.InitializeResult{}, err
+		}
+	}
+	return result, nil
+}
+
+// recordLegendOffset assigns serverName the tokenOffset needed to shift its
+// own SemanticTokensLegend indices into the merged legend, based on the
+// merged legend's size so far, then grows that size by capabilities' own
+// legend. Called once per server, from bootstrap, so every server gets an
+// entry in legendOffsets however and whenever it was started - unlike
+// before, when only servers already running at handleInitialize time got
+// one and every lazily-started server fell back to the zero-value offset,
+// corrupting merged semantic highlighting once more than one of them
+// emitted tokens for the same document.
+func (s *ProxyServer) recordLegendOffset(serverName string, capabilities protocol.ServerCapabilities) tokenOffset {
+	legend := legendOf(capabilities.SemanticTokensProvider)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.legendOffsets == nil {
+		s.legendOffsets = make(map[string]tokenOffset)
+	}
+	offset := s.legendLen
+	s.legendOffsets[serverName] = offset
+	s.legendLen.tokenType += len(legend.tokenTypes)
+	s.legendLen.tokenModifier += len(legend.tokenModifiers)
+	return offset
+}
+
+// deadlineFor returns how long handleProcs should wait on a single backend
+// for method before dropping it, per defaultRequestDeadlines and any
+// override from the config passed to NewProxyServer. Zero means no deadline.
+func (s *ProxyServer) deadlineFor(method string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deadlines[method]
+}
+
+// handleProcs fans req out to every proc and waits for all of them, same as
+// before per-request deadlines existed, when deadline <= 0. With deadline >
+// 0, any backend that doesn't answer within it is dropped instead of
+// holding up the rest (see ProcessServer.CallWithDeadline): its slot in
+// results is left at the zero value and its index is marked in dropped, so
+// callers that need to know which procs[i] a result came from can skip it.
+func handleProcs[T any](ctx context.Context, req *jsonrpc2.Request, procs []*ProcessServer, deadline time.Duration) (results []T, dropped []bool, err error) {
 	eg := errgroup.Group{}
 
-	results := make([]T, len(procs))
+	results = make([]T, len(procs))
+	dropped = make([]bool, len(procs))
 	for i, proc := range procs {
 		index := i
 		newProc := proc
@@ -42,7 +327,12 @@ func handleProcs[T any](ctx context.Context, req *jsonrpc2.Request, procs []*Pro
 		eg.Go(func() error {
 			var result T
 
-			if err := newProc.Call(ctx, req.Method, req.Params, &result); err != nil {
+			timedOut, err := newProc.CallWithDeadline(ctx, req.Method, req.Params, &result, deadline)
+			if timedOut {
+				dropped[index] = true
+				return nil
+			}
+			if err != nil {
 				return err
 			}
 			results[index] = result
@@ -50,9 +340,30 @@ func handleProcs[T any](ctx context.Context, req *jsonrpc2.Request, procs []*Pro
 		})
 	}
 	if err := eg.Wait(); err != nil {
+		return nil, nil, err
+	}
+	return results, dropped, nil
+}
+
+// broadcastFirst fans req out to every started server via s.runningForRequest
+// and returns the first non-dropped result, the same single-result-for-a-
+// multi-server-method compromise the default case in handle used before
+// methods started being routed by owner.
+func (s *ProxyServer) broadcastFirst(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	procs := s.runningForRequest(req)
+	if len(procs) == 0 {
+		return nil, nil
+	}
+	results, dropped, err := handleProcs[json.RawMessage](ctx, req, procs, s.deadlineFor(req.Method))
+	if err != nil {
 		return nil, err
 	}
-	return results, nil
+	for i, d := range dropped {
+		if !d {
+			return results[i], nil
+		}
+	}
+	return nil, nil
 }
 
 func (s *ProxyServer) Wait() error {
@@ -88,9 +399,40 @@ func (s *ProxyServer) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *json
 }
 
 func (s *ProxyServer) handleNotify(ctx context.Context, req *jsonrpc2.Request) error {
+	switch req.Method {
+	case protocol.MethodInitialized:
+		s.mu.Lock()
+		s.clientInitialized = req.Params
+		s.mu.Unlock()
+		// Servers started eagerly by ensureServersForRoot were bootstrapped
+		// before the client's initialized notification existed to replay, so
+		// they still need it forwarded now. Servers ensureServers starts
+		// later already get both initialize and initialized from bootstrap
+		// in one go, since by then s.clientInitialized is already cached.
+		return notifyProcs(ctx, req, s.running())
+	case protocol.MethodTextDocumentDidOpen:
+		return s.handleTextDocumentDidOpen(ctx, req)
+	case protocol.MethodTextDocumentDidChange, protocol.MethodTextDocumentDidClose, protocol.MethodTextDocumentDidSave:
+		return notifyProcs(ctx, req, s.runningForRequest(req))
+	default:
+		return notifyProcs(ctx, req, s.running())
+	}
+}
+
+// runningForRequest resolves the started servers a document-scoped
+// notification should go to, based on the textDocument.uri it carries.
+func (s *ProxyServer) runningForRequest(req *jsonrpc2.Request) []*ProcessServer {
+	uri, ok := extractURI(req.Params)
+	if !ok {
+		return s.running()
+	}
+	return s.runningFor(uri)
+}
+
+func notifyProcs(ctx context.Context, req *jsonrpc2.Request, procs []*ProcessServer) error {
 	eg := errgroup.Group{}
 
-	for _, proc := range s.procs {
+	for _, proc := range procs {
 		newProc := proc
 
 		eg.Go(func() error {
@@ -100,80 +442,340 @@ func (s *ProxyServer) handleNotify(ctx context.Context, req *jsonrpc2.Request) e
 	return eg.Wait()
 }
 
+func (s *ProxyServer) handleTextDocumentDidOpen(ctx context.Context, req *jsonrpc2.Request) error {
+	var params protocol.DidOpenTextDocumentParams
+	if err := json.Unmarshal(*req.Params, &params); err != nil {
+		return err
+	}
+
+	procs, err := s.ensureServers(ctx, params.TextDocument.URI, string(params.TextDocument.LanguageID))
+	if err != nil {
+		return err
+	}
+	return notifyProcs(ctx, req, procs)
+}
+
+// extractURI pulls a "textDocument.uri" field out of request params, the
+// shape shared by every document-scoped LSP request and notification.
+func extractURI(params *json.RawMessage) (protocol.DocumentURI, bool) {
+	if params == nil {
+		return "", false
+	}
+
+	var v struct {
+		TextDocument struct {
+			URI protocol.DocumentURI `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal(*params, &v); err != nil || v.TextDocument.URI == "" {
+		return "", false
+	}
+	return v.TextDocument.URI, true
+}
+
+// MethodLspxStatus is a custom method, not part of LSP, that Emacs can call
+// to learn about the health of each backing ProcessServer.
+const MethodLspxStatus = "lspx.status"
+
 func (s *ProxyServer) handle(ctx context.Context, req *jsonrpc2.Request) (any, error) {
 	switch req.Method {
 	case protocol.MethodInitialize:
 		return s.handleInitialize(ctx, req)
 	case protocol.MethodTextDocumentCompletion:
 		return s.handleTextDocumentCompletion(ctx, req)
-	// case protocol.MethodTextDocumentPublishDiagnostics:
-	//	return s.handleTextDocumentPublishDiagnostics(ctx, req)
+	case MethodLspxStatus:
+		return s.handleStatus(ctx, req)
+	case protocol.MethodSemanticTokensFull:
+		return s.handleTextDocumentSemanticTokensFull(ctx, req)
+	case protocol.MethodTextDocumentCodeAction:
+		return s.handleTextDocumentCodeAction(ctx, req)
+	case protocol.MethodWorkspaceExecuteCommand:
+		return s.handleWorkspaceExecuteCommand(ctx, req)
 	default:
-		results, err := handleProcs[json.RawMessage](ctx, req, s.procs)
-		if err != nil {
-			return nil, err
-		}
-		return results[0], nil
+		return s.broadcastFirst(ctx, req)
 	}
 }
 
+// handleInitialize caches the client's initialize params, so they can later
+// be replayed into servers started lazily by ensureServers, synchronously
+// starts every server whose RootPatterns match the client's workspace root
+// (see ensureServersForRoot), and merges their capabilities into a single
+// InitializeResult. The LSP handshake is always initialize -> initialized
+// -> didOpen, so without this, initialize would always reply before a
+// single server had started and the client would conclude the proxy
+// supports nothing. Servers that can only be matched once a specific
+// document is known (Filetypes/Glob with no RootPatterns) still start
+// later from ensureServers and aren't reflected here.
 func (s *ProxyServer) handleInitialize(ctx context.Context, req *jsonrpc2.Request) (any, error) {
-	results, err := handleProcs[protocol.InitializeResult](ctx, req, s.procs)
+	s.mu.Lock()
+	s.clientInitialize = req.Params
+	s.mu.Unlock()
+
+	// procs is exactly the set ensureServersForRoot just started - nothing
+	// can already be running this early - so bootstrapped has every one of
+	// their InitializeResults; namespacing their commands and recording
+	// their legend offsets already happened inside bootstrap.
+	procs, bootstrapped, err := s.ensureServersForRoot(ctx, workspaceRoot(req.Params))
 	if err != nil {
 		return nil, err
 	}
+	if len(procs) == 0 {
+		return protocol.InitializeResult{}, nil
+	}
+
+	results := make([]protocol.InitializeResult, len(procs))
+	for i, proc := range procs {
+		results[i] = bootstrapped[proc.name]
+	}
 
 	inititalize := protocol.InitializeResult{
 		ServerInfo:   results[0].ServerInfo,
 		Capabilities: results[0].Capabilities,
 	}
-
 	for _, result := range results[1:] {
-		newCapabilities := merge(&inititalize.Capabilities, &result.Capabilities)
-
-		c, ok := newCapabilities.(*protocol.ServerCapabilities)
-		if ok {
-			inititalize.Capabilities = *c
-		}
+		inititalize.Capabilities, _ = mergeServerCapabilities(inititalize.Capabilities, result.Capabilities)
 	}
+
 	return inititalize, nil
 }
 
-func (s *ProxyServer) handleTextDocumentCompletion(ctx context.Context, req *jsonrpc2.Request) (any, error) {
-	results, err := handleProcs[protocol.CompletionList](ctx, req, s.procs)
-	if err != nil {
-		return nil, err
+// registerCommands namespaces provider's commands with serverName (see
+// namespaceExecuteCommands) and records serverName as their owner in
+// s.commands for handleWorkspaceExecuteCommand to route by. Called both for
+// servers already running at handleInitialize and for ones started lazily
+// afterward by bootstrap.
+func (s *ProxyServer) registerCommands(serverName string, provider *protocol.ExecuteCommandOptions) *protocol.ExecuteCommandOptions {
+	namespaced := namespaceExecuteCommands(serverName, provider)
+	if namespaced == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.commands == nil {
+		s.commands = make(map[string]string)
+	}
+	for _, command := range namespaced.Commands {
+		s.commands[command] = serverName
 	}
+	s.mu.Unlock()
 
+	return namespaced
+}
+
+func (s *ProxyServer) handleTextDocumentCompletion(ctx context.Context, req *jsonrpc2.Request) (any, error) {
 	completion := protocol.CompletionList{
 		Items:        make([]protocol.CompletionItem, 0),
 		IsIncomplete: false,
 	}
-	for _, result := range results {
+
+	procs := s.runningForRequest(req)
+	if len(procs) == 0 {
+		return completion, nil
+	}
+
+	results, dropped, err := handleProcs[protocol.CompletionList](ctx, req, procs, s.deadlineFor(req.Method))
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if dropped[i] {
+			completion.IsIncomplete = true
+			continue
+		}
 		if result.IsIncomplete {
 			completion.IsIncomplete = true
 			continue
 		}
-		completion.Items = append(completion.Items, result.Items...)
+		for _, item := range result.Items {
+			if item.Command != nil {
+				item.Command.Command = namespaceCommand(procs[i].name, item.Command.Command)
+			}
+			completion.Items = append(completion.Items, item)
+		}
 	}
 	return completion, nil
 }
 
-// func (s *ProxyServer) handleTextDocumentPublishDiagnostics(ctx context.Context, req *jsonrpc2.Request) (any, error) {
-//	results, err := handleProcs[protocol.PublishDiagnosticsParams](ctx, req, s.procs)
-//	if err != nil {
-//		return nil, err
-//	}
-//	return results[0], nil
-// }
+// handleTextDocumentCodeAction aggregates code actions from every server
+// handling the document and, like the namespacing of advertised commands
+// (see namespaceExecuteCommands), prefixes each action's Command.Command
+// with its owning server's name so a later workspace/executeCommand routes
+// back to it instead of being broadcast.
+func (s *ProxyServer) handleTextDocumentCodeAction(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	procs := s.runningForRequest(req)
+	if len(procs) == 0 {
+		return []protocol.CodeAction{}, nil
+	}
+
+	results, dropped, err := handleProcs[[]protocol.CodeAction](ctx, req, procs, s.deadlineFor(req.Method))
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]protocol.CodeAction, 0)
+	for i, result := range results {
+		if dropped[i] {
+			continue
+		}
+		for _, action := range result {
+			if action.Command != nil {
+				action.Command.Command = namespaceCommand(procs[i].name, action.Command.Command)
+			}
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+// handleTextDocumentSemanticTokensFull merges the token streams of every
+// server handling the document. Each server's tokenType/tokenModifiers
+// indices are shifted by the offset recordLegendOffset recorded for it when
+// it was bootstrapped, so they refer into the merged legend instead of that
+// server's own,
+// then the streams are combined in document order and re-encoded.
+func (s *ProxyServer) handleTextDocumentSemanticTokensFull(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	procs := s.runningForRequest(req)
+	if len(procs) == 0 {
+		return protocol.SemanticTokens{Data: []uint32{}}, nil
+	}
+
+	results, _, err := handleProcs[protocol.SemanticTokens](ctx, req, procs, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	offsets := s.legendOffsets
+	s.mu.Unlock()
+
+	var tokens []semanticToken
+	for i, result := range results {
+		tokens = append(tokens, decodeSemanticTokens(result.Data, offsets[procs[i].name])...)
+	}
+	return protocol.SemanticTokens{Data: encodeSemanticTokens(tokens)}, nil
+}
+
+// handleWorkspaceExecuteCommand strips the serverName: prefix
+// namespaceExecuteCommands added to the command when its server was
+// bootstrapped (see registerCommands) and
+// routes the call to exactly the server that registered it, rather than
+// broadcasting it to every running server.
+func (s *ProxyServer) handleWorkspaceExecuteCommand(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	var params protocol.ExecuteCommandParams
+	if err := json.Unmarshal(*req.Params, &params); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	serverName, ok := s.commands[params.Command]
+	proc := s.procs[serverName]
+	s.mu.Unlock()
+
+	if !ok || proc == nil {
+		// Not a command we've namespaced - e.g. one a server registered
+		// dynamically after its initialize handshake. Fall back to
+		// broadcasting it the way workspace/executeCommand was handled
+		// before commands were routed by owner.
+		return s.broadcastFirst(ctx, req)
+	}
+	params.Command = strings.TrimPrefix(params.Command, serverName+":")
+
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	raw := json.RawMessage(rawParams)
+
+	var result json.RawMessage
+	if err := proc.Call(ctx, req.Method, &raw, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *ProxyServer) handleStatus(ctx context.Context, req *jsonrpc2.Request) (any, error) {
+	procs := s.running()
+
+	statuses := make([]ServerStatus, len(procs))
+	for i, proc := range procs {
+		statuses[i] = proc.Status()
+	}
+	return statuses, nil
+}
+
+// handleTextDocumentPublishDiagnostics merges diagnostics for uri across all
+// servers that have reported on it. Diagnostics are stateful per-server per-
+// URI, so only the notifying server's slice is replaced; the others are kept
+// as last reported. The merged Source is prefixed with serverName (e.g.
+// "gopls/typecheck") so the editor can tell servers apart.
+func (s *ProxyServer) handleTextDocumentPublishDiagnostics(ctx context.Context, serverName string, params protocol.PublishDiagnosticsParams) error {
+	for i := range params.Diagnostics {
+		if params.Diagnostics[i].Source != "" {
+			params.Diagnostics[i].Source = serverName + "/" + params.Diagnostics[i].Source
+		} else {
+			params.Diagnostics[i].Source = serverName
+		}
+	}
+
+	s.diagMu.Lock()
+	if s.diagnostics == nil {
+		s.diagnostics = make(map[protocol.DocumentURI]map[string][]protocol.Diagnostic)
+	}
+	byServer, ok := s.diagnostics[params.URI]
+	if !ok {
+		byServer = make(map[string][]protocol.Diagnostic)
+		s.diagnostics[params.URI] = byServer
+	}
+	byServer[serverName] = params.Diagnostics
+
+	merged := make([]protocol.Diagnostic, 0, len(params.Diagnostics))
+	for _, diags := range byServer {
+		merged = append(merged, diags...)
+	}
+	if s.dedupeDiagnostics {
+		merged = dedupeDiagnostics(merged)
+	}
+	s.diagMu.Unlock()
+
+	return s.conn.Notify(ctx, protocol.MethodTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+		URI:         params.URI,
+		Version:     params.Version,
+		Diagnostics: merged,
+	})
+}
+
+// dedupeDiagnostics drops diagnostics that share an identical
+// (range, code, message) with one already kept, preserving order.
+func dedupeDiagnostics(diags []protocol.Diagnostic) []protocol.Diagnostic {
+	seen := make(map[string]struct{}, len(diags))
+	result := make([]protocol.Diagnostic, 0, len(diags))
+	for _, d := range diags {
+		key := fmt.Sprintf("%+v\x00%v\x00%s", d.Range, d.Code, d.Message)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, d)
+	}
+	return result
+}
+
+// NewProxyServer creates a multiplexer for the servers declared in configs.
+// Unlike the old flat server list, nothing is started here: servers whose
+// RootPatterns match the workspace root are started by handleInitialize, and
+// the rest are spawned lazily by ensureServers once a document matching
+// their filters is opened. requestDeadlines overrides defaultRequestDeadlines per method;
+// pass nil to use the defaults unmodified.
+func NewProxyServer(ctx context.Context, configs map[string]ServerConfig, dedupeDiagnostics bool, requestDeadlines map[string]time.Duration) (*ProxyServer, error) {
+	deadlines := maps.Clone(defaultRequestDeadlines)
+	maps.Copy(deadlines, requestDeadlines)
 
-func NewProxyServer(ctx context.Context, procs []*ProcessServer) (*ProxyServer, error) {
 	proxy := &ProxyServer{
-		procs: procs,
+		configs:           configs,
+		procs:             make(map[string]*ProcessServer),
+		dedupeDiagnostics: dedupeDiagnostics,
+		deadlines:         deadlines,
 	}
 	proxy.conn = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(stdrwc{}, jsonrpc2.VSCodeObjectCodec{}), proxy)
-	for _, proc := range procs {
-		proc.proxyConn = proxy.conn
-	}
 	return proxy, nil
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func TestRegisterCommands(t *testing.T) {
+	s := &ProxyServer{}
+
+	namespaced := s.registerCommands("gopls", &protocol.ExecuteCommandOptions{Commands: []string{"gopls.fill_struct"}})
+	if namespaced == nil {
+		t.Fatal("registerCommands returned nil for a non-nil provider")
+	}
+	if want := "gopls:gopls.fill_struct"; namespaced.Commands[0] != want {
+		t.Errorf("namespaced command = %q, want %q", namespaced.Commands[0], want)
+	}
+	if got := s.commands["gopls:gopls.fill_struct"]; got != "gopls" {
+		t.Errorf("commands[%q] = %q, want %q", namespaced.Commands[0], got, "gopls")
+	}
+
+	if got := s.registerCommands("pyright", nil); got != nil {
+		t.Errorf("registerCommands(nil provider) = %+v, want nil", got)
+	}
+}
+
+// executeCommandHandler answers a workspace/executeCommand by echoing back
+// the (already de-namespaced) command it received.
+type executeCommandHandler struct{}
+
+func (executeCommandHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) {
+	var params protocol.ExecuteCommandParams
+	if err := json.Unmarshal(*req.Params, &params); err != nil {
+		conn.ReplyWithError(ctx, req.ID, &jsonrpc2.Error{Message: err.Error()})
+		return
+	}
+	conn.Reply(ctx, req.ID, params.Command)
+}
+
+func newExecuteCommandServer(t *testing.T, name string) *ProcessServer {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+
+	ctx := context.Background()
+	jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(server, jsonrpc2.VSCodeObjectCodec{}), executeCommandHandler{})
+	conn := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(client, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(
+		func(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+			return nil, nil
+		}))
+	return &ProcessServer{name: name, conn: conn}
+}
+
+func TestHandleWorkspaceExecuteCommandRoutesToOwner(t *testing.T) {
+	gopls := newExecuteCommandServer(t, "gopls")
+
+	s := &ProxyServer{procs: map[string]*ProcessServer{"gopls": gopls}}
+	s.registerCommands("gopls", &protocol.ExecuteCommandOptions{Commands: []string{"fill_struct"}})
+
+	params, err := json.Marshal(protocol.ExecuteCommandParams{Command: "gopls:fill_struct"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := json.RawMessage(params)
+	req := &jsonrpc2.Request{Method: protocol.MethodWorkspaceExecuteCommand, Params: &raw}
+
+	result, err := s.handleWorkspaceExecuteCommand(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handleWorkspaceExecuteCommand: %v", err)
+	}
+
+	var got string
+	if err := json.Unmarshal(result.(json.RawMessage), &got); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if want := "fill_struct"; got != want {
+		t.Errorf("server received command %q, want the serverName: prefix stripped to %q", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestDedupeDiagnostics(t *testing.T) {
+	diags := []protocol.Diagnostic{
+		{
+			Range:   protocol.Range{Start: protocol.Position{Line: 1}},
+			Code:    "E1",
+			Message: "unused variable",
+			Source:  "gopls",
+		},
+		{
+			Range:   protocol.Range{Start: protocol.Position{Line: 1}},
+			Code:    "E1",
+			Message: "unused variable",
+			Source:  "staticcheck",
+		},
+		{
+			Range:   protocol.Range{Start: protocol.Position{Line: 2}},
+			Code:    "E2",
+			Message: "missing return",
+			Source:  "gopls",
+		},
+	}
+
+	deduped := dedupeDiagnostics(diags)
+
+	if len(deduped) != 2 {
+		t.Fatalf("len(deduped) = %d, want 2: %+v", len(deduped), deduped)
+	}
+	if deduped[0].Source != "gopls" {
+		t.Errorf("deduped[0].Source = %q, want the first-seen server kept", deduped[0].Source)
+	}
+	if deduped[1].Message != "missing return" {
+		t.Errorf("deduped[1] = %+v, want the distinct diagnostic preserved", deduped[1])
+	}
+}